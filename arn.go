@@ -0,0 +1,120 @@
+package awstempcreds
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParsedRoleARN holds the fields of an IAM role ARN such as
+// arn:aws:iam::123456789012:role/team/deployer.
+type ParsedRoleARN struct {
+	Partition string
+	AccountID string
+	// Path is "/" unless the role was created with a path, e.g. "/team/".
+	Path string
+	Name string
+}
+
+func (a ParsedRoleARN) String() string {
+	path := a.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("arn:%s:iam::%s:role%s%s", a.Partition, a.AccountID, path, a.Name)
+}
+
+// BuildRoleARN returns the ARN of the role with the given name, optionally
+// preceded by its path (e.g. "team/deployer"), after validating its fields.
+func BuildRoleARN(partition, accountID, roleNameOrPath string) (string, error) {
+	a := ParsedRoleARN{Partition: partition, AccountID: accountID, Path: "/"}
+
+	roleNameOrPath = strings.TrimPrefix(roleNameOrPath, "/")
+	if i := strings.LastIndex(roleNameOrPath, "/"); i >= 0 {
+		a.Path = "/" + roleNameOrPath[:i+1]
+		a.Name = roleNameOrPath[i+1:]
+	} else {
+		a.Name = roleNameOrPath
+	}
+
+	err := a.validate()
+	if err != nil {
+		return "", err
+	}
+	return a.String(), nil
+}
+
+// ParseRoleARN splits an IAM role ARN into its fields.
+func ParseRoleARN(arn string) (ParsedRoleARN, error) {
+	fields := strings.SplitN(arn, ":", 6)
+	if len(fields) != 6 || fields[0] != "arn" || fields[2] != "iam" || fields[3] != "" {
+		return ParsedRoleARN{}, fmt.Errorf("%q is not an IAM ARN", arn)
+	}
+	if !strings.HasPrefix(fields[5], "role/") {
+		return ParsedRoleARN{}, fmt.Errorf("%q is not a role ARN", arn)
+	}
+
+	resource := strings.TrimPrefix(fields[5], "role")
+	i := strings.LastIndex(resource, "/")
+	a := ParsedRoleARN{
+		Partition: fields[1],
+		AccountID: fields[4],
+		Path:      resource[:i+1],
+		Name:      resource[i+1:],
+	}
+
+	err := a.validate()
+	if err != nil {
+		return ParsedRoleARN{}, fmt.Errorf("invalid role ARN %q: %s", arn, err)
+	}
+	return a, nil
+}
+
+func (a ParsedRoleARN) validate() error {
+	if a.Partition == "" {
+		return fmt.Errorf("partition is empty")
+	}
+	if len(a.AccountID) != 12 || strings.Trim(a.AccountID, "0123456789") != "" {
+		return fmt.Errorf("account ID %q is not 12 digits", a.AccountID)
+	}
+	if err := validatePath(a.Path); err != nil {
+		return err
+	}
+	if a.Name == "" || len(a.Name) > 64 {
+		return fmt.Errorf("role name %q must be 1 to 64 characters long", a.Name)
+	}
+	for _, c := range a.Name {
+		if !isRoleNameChar(c) {
+			return fmt.Errorf("role name %q contains invalid character %q", a.Name, c)
+		}
+	}
+	return nil
+}
+
+// Paths are validated as IAM does: they start and end with a slash, have no
+// empty segments, and consist of at most 512 printable ASCII characters.
+// An empty path stands for "/".
+func validatePath(path string) error {
+	if path == "" || path == "/" {
+		return nil
+	}
+	if len(path) > 512 {
+		return fmt.Errorf("path %q is longer than 512 characters", path)
+	}
+	if !strings.HasPrefix(path, "/") || !strings.HasSuffix(path, "/") {
+		return fmt.Errorf("path %q must start and end with a slash", path)
+	}
+	if strings.Contains(path, "//") {
+		return fmt.Errorf("path %q contains an empty segment", path)
+	}
+	for _, c := range path {
+		if c < 0x21 || c > 0x7e {
+			return fmt.Errorf("path %q contains invalid character %q", path, c)
+		}
+	}
+	return nil
+}
+
+// Characters IAM allows in role names.
+func isRoleNameChar(c rune) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune("_+=,.@-", c)
+}
@@ -0,0 +1,26 @@
+package awstempcreds
+
+import "testing"
+
+func TestParsedRoleARNString(t *testing.T) {
+	a := ParsedRoleARN{Partition: "aws", AccountID: "123456789012", Name: "deployer"}
+	if got := a.String(); got != "arn:aws:iam::123456789012:role/deployer" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestBuildRoleARNPath(t *testing.T) {
+	for roleNameOrPath, valid := range map[string]bool{
+		"deployer":        true,
+		"team/deployer":   true,
+		"/team/ci/deploy": true,
+		"team//deployer":  false,
+		"te am/deployer":  false,
+		"tëam/deployer":   false,
+	} {
+		_, err := BuildRoleARN("aws", "123456789012", roleNameOrPath)
+		if (err == nil) != valid {
+			t.Errorf("BuildRoleARN(%q): got error %v, want valid %v", roleNameOrPath, err, valid)
+		}
+	}
+}
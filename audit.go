@@ -0,0 +1,169 @@
+package awstempcreds
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/awslabs/aws-sdk-go/service/sts"
+)
+
+// AuditRecord describes a single AssumeRole call and its outcome.
+type AuditRecord struct {
+	Time            time.Time `json:"time"`
+	RoleARN         string    `json:"role_arn"`
+	SessionName     string    `json:"session_name"`
+	DurationSeconds int64     `json:"duration_seconds"`
+	// AssumedRoleARN identifies the resulting session, if the call succeeded.
+	AssumedRoleARN string `json:"assumed_role_arn,omitempty"`
+	// Error is empty if the call succeeded.
+	Error string `json:"error,omitempty"`
+	// Name and Labels of the provider making the call.
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// AuditSink records role assumptions, e.g. for a client-side security trail.
+// Audit is called while the provider is refreshing, so it must not obtain
+// credentials from the provider being audited.
+type AuditSink interface {
+	Audit(record AuditRecord) error
+}
+
+func (p *TempCredentialsProvider) audit(input *sts.AssumeRoleInput, role *sts.AssumeRoleOutput, err error) {
+	if p.AuditSink == nil {
+		return
+	}
+
+	record := AuditRecord{
+		Time:            time.Now(),
+		RoleARN:         *input.RoleARN,
+		SessionName:     *input.RoleSessionName,
+		DurationSeconds: *input.DurationSeconds,
+		Name:            p.Name,
+		Labels:          p.Labels,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	} else if role != nil && role.AssumedRoleUser != nil && role.AssumedRoleUser.ARN != nil {
+		record.AssumedRoleARN = *role.AssumedRoleUser.ARN
+	}
+
+	// Failing to audit must not prevent the credentials from being used.
+	if err := p.AuditSink.Audit(record); err != nil {
+		p.logEvent("error", "audit-failed", err, time.Time{}, "TempCredentialsProvider failed to write audit record: %s\n", err)
+	}
+}
+
+// FileAuditSink appends audit records to a file as JSON lines.
+type FileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditSink opens (or creates) the file at path for appending.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditSink{file: file}, nil
+}
+
+func (s *FileAuditSink) Audit(record AuditRecord) error {
+	line, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close the underlying file.
+func (s *FileAuditSink) Close() error {
+	return s.file.Close()
+}
+
+// CloudWatchLogsAuditSink writes audit records to an existing CloudWatch Logs stream.
+type CloudWatchLogsAuditSink struct {
+	mu            sync.Mutex
+	client        *cloudwatchlogs.CloudWatchLogs
+	group         string
+	stream        string
+	sequenceToken *string
+}
+
+// NewCloudWatchLogsAuditSink writes to the given log group and stream, which must already exist.
+// The config must not obtain its credentials from the provider being audited:
+// once those expire, the refresh would wait on itself.
+func NewCloudWatchLogsAuditSink(config *aws.Config, group, stream string) *CloudWatchLogsAuditSink {
+	return &CloudWatchLogsAuditSink{
+		client: cloudwatchlogs.New(config),
+		group:  group,
+		stream: stream,
+	}
+}
+
+func (s *CloudWatchLogsAuditSink) Audit(record AuditRecord) error {
+	message, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.put(string(message), record.Time)
+	if apiErr := aws.Error(err); apiErr != nil && apiErr.Code == "InvalidSequenceTokenException" {
+		// Someone else wrote to the stream - pick up its current token and retry once.
+		err = s.fetchSequenceToken()
+		if err != nil {
+			return err
+		}
+		err = s.put(string(message), record.Time)
+	}
+	return err
+}
+
+func (s *CloudWatchLogsAuditSink) put(message string, t time.Time) error {
+	out, err := s.client.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(s.group),
+		LogStreamName: aws.String(s.stream),
+		SequenceToken: s.sequenceToken,
+		LogEvents: []*cloudwatchlogs.InputLogEvent{{
+			Message:   aws.String(message),
+			Timestamp: aws.Long(t.UnixNano() / int64(time.Millisecond)),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	s.sequenceToken = out.NextSequenceToken
+	return nil
+}
+
+func (s *CloudWatchLogsAuditSink) fetchSequenceToken() error {
+	out, err := s.client.DescribeLogStreams(&cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        aws.String(s.group),
+		LogStreamNamePrefix: aws.String(s.stream),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, stream := range out.LogStreams {
+		if stream.LogStreamName != nil && *stream.LogStreamName == s.stream {
+			s.sequenceToken = stream.UploadSequenceToken
+			return nil
+		}
+	}
+	s.sequenceToken = nil
+	return nil
+}
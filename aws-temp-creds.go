@@ -2,67 +2,645 @@
 	Package awstempcreds contains helpers for temporary STS credentials.
 
 	TempCredentialsProvider obtains temporary credentials,
-	and makes sure they are rolled over before expiry.
+	and makes sure they are rolled over before expiry. Manager refreshes
+	a set of providers in the background ahead of their expiry.
 
-	This package is not safe for multithreaded use.
+	TempCredentialsProvider is safe for concurrent use, but its exported
+	fields must not be changed once it is in use.
 */
 package awstempcreds
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/awslabs/aws-sdk-go/aws"
 	"github.com/awslabs/aws-sdk-go/service/sts"
-	"log"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Credentials are refreshed this long before they are due to expire,
+// unless ExpiryWindow says otherwise.
+const defaultExpiryWindow = 5 * time.Minute
+
+// AssumeRoler is the subset of the STS API used by the provider. It matches
+// stscreds.AssumeRoler, so the STS implementation can be swapped for an
+// adapter over another SDK, a proxy, or a test double.
+type AssumeRoler interface {
+	AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error)
+}
+
 type TempCredentialsProvider struct {
-	Region      string
-	Duration    time.Duration
-	RoleARN     string
+	// Name and Labels identify the provider in metrics, logs, audit records
+	// and events, so that multi-role deployments can tell sessions apart.
+	Name   string
+	Labels map[string]string
+
+	Region   string
+	Duration time.Duration
+	RoleARN  string
+	// DurationProvider, if set, is called on each refresh to pick the session
+	// duration instead of Duration, e.g. to issue longer sessions overnight.
+	DurationProvider func() time.Duration
+	// FallbackRoleARNs are tried in order if assuming RoleARN is denied,
+	// e.g. while old and new role names coexist during an IAM migration.
+	FallbackRoleARNs []string
+	// Policy is an optional inline session policy further restricting the role.
+	// Alternatively, PolicyTemplate is rendered on each refresh using
+	// text/template, see PolicyData for the fields available to it.
+	Policy         string
+	PolicyTemplate string
+	// PolicyVars, if set, supplies the Vars made available to PolicyTemplate,
+	// such as a tenant ID.
+	PolicyVars func() map[string]string
+	// ExternalID is passed to STS if the role's trust policy requires one.
+	// ExternalIDProvider, if set, is called on each refresh instead,
+	// for external IDs that are rotated.
+	ExternalID         string
+	ExternalIDProvider func() (string, error)
+	// RoleSessionName overrides the generated temp-<hostname>-<time> session name.
+	RoleSessionName string
+	// ExpiryWindow is how long before expiry the credentials are refreshed.
+	// Defaults to 5 minutes.
+	ExpiryWindow time.Duration
+	// Client performs the AssumeRole calls. Defaults to an STS client for
+	// Region, or for the role's partition if Region is empty.
+	// AppID and EndpointResolver only apply to the default client.
+	Client AssumeRoler
+	// AppID is appended to the User-Agent of STS calls, so that they can be
+	// told apart in CloudTrail and VPC logs.
+	AppID string
+	// EndpointResolver, if set, picks the endpoint of the default client,
+	// e.g. to route through an internal STS proxy. An empty result falls
+	// back to the SDK's own endpoint for the region.
+	EndpointResolver func(service, region string) (string, error)
+
+	// SerialNumber identifies the MFA device required by the role, if any.
+	// TokenProvider is then called on each refresh to obtain the current code.
+	SerialNumber  string
+	TokenProvider func() (string, error)
+
+	// BeforeAssumeRole, if set, is called with the input of every AssumeRole
+	// call just before it is made, to set fields this package does not model.
+	BeforeAssumeRole func(input *sts.AssumeRoleInput)
+	// AfterAssumeRole, if set, is called with the raw result of every
+	// AssumeRole call, e.g. to inspect PackedPolicySize or flag anomalies.
+	AfterAssumeRole func(output *sts.AssumeRoleOutput, err error)
+
+	// AuditSink, if set, receives a record of every AssumeRole call.
+	AuditSink AuditSink
+	// Budget, if set, rate-limits AssumeRole calls. It may be shared.
+	Budget *Budget
+	// ExpiryAlertThreshold, if set, raises EventExpiryImminent once refreshes
+	// keep failing while the current credentials expire within this long.
+	ExpiryAlertThreshold time.Duration
+	// DotEnvPath, if set, is rewritten with AWS_* variables on every refresh,
+	// for toolchains that can only read credentials from env files.
+	DotEnvPath string
+	// InMemoryOnly guarantees that credentials never leave memory: no role is
+	// assumed while DotEnvPath is set, and Snapshot refuses to run.
+	InMemoryOnly bool
+	// JSONLogging switches log output from free text to JSON lines,
+	// so that it can be ingested by log pipelines.
+	JSONLogging bool
+
+	// Serialises refreshes. Never acquired while holding mu.
+	refreshMu sync.Mutex
+	// Guards everything below, except events which has its own lock.
+	mu          sync.Mutex
+	refreshing  bool
 	role        *sts.AssumeRoleOutput
+	creds       *aws.Credentials
 	nextRefresh time.Time
+	metrics     *expvarMetrics
+	events      eventBus
+	queued      []Event
+	skew        time.Duration
+	alerted     bool
+	// Set once EventExpiringSoon has been raised for the current session.
+	expiringSoon bool
+
+	// Refresh statistics, see stats.go.
+	lastRefresh         time.Time
+	lastErr             error
+	consecutiveFailures int
+	refreshes           int
+
+	// Usage statistics, see usage.go.
+	uses           int
+	lastUsed       time.Time
+	sessionUses    int
+	unusedSessions int
+	unusedCounted  bool
+}
+
+// NewEager assumes the role straight away, rather than on the first call to
+// Credentials, so that misconfiguration is caught at startup.
+func NewEager(p *TempCredentialsProvider) (*TempCredentialsProvider, error) {
+	// Not via Credentials, which would count as a use of the session.
+	err := p.refreshUnless(func() bool { return p.lasts(0) })
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
 // Refresh the temporary credentials - get a new role.
 func (p *TempCredentialsProvider) Refresh() error {
-	stsClient := sts.New(&aws.Config{
-		Region: p.Region,
-	})
+	p.refreshMu.Lock()
+	events, err := p.refresh()
+	p.refreshMu.Unlock()
+
+	p.deliver(events)
+	return err
+}
 
-	hostname, err := os.Hostname()
+// Called with refreshMu held. mu is only taken once STS has answered,
+// so that the current credentials stay available in the meantime.
+// The events raised are handed back for delivery once refreshMu is released.
+func (p *TempCredentialsProvider) refresh() ([]Event, error) {
+	duration, err := p.sessionDuration()
+	var role *sts.AssumeRoleOutput
+	var date responseDate
+	start := time.Now()
+	if err == nil {
+		role, err = p.assume(duration, &date)
+	}
+	if err == nil {
+		err = checkCredentials(role)
+	}
+	end := time.Now()
+
+	p.mu.Lock()
 	if err != nil {
-		hostname = "unknown"
+		// Keep the previous role - it may still be valid.
+		p.lastErr = err
+		p.consecutiveFailures++
+		p.metrics.recordFailure()
+		p.emit(Event{Type: EventRefreshFailed, Expiration: p.expiration(), Err: err})
+		if p.role != nil {
+			p.emitExpiry(err)
+			p.nextRefresh = p.retryAt()
+		}
+		return p.unlockQueued(), err
 	}
 
-	p.role, err = stsClient.AssumeRole(&sts.AssumeRoleInput{
-		DurationSeconds: aws.Long(int64(p.Duration / time.Second)),
+	p.setRole(role)
+	p.measureSkew(duration, start, end, date)
+	if role.Credentials.Expiration == nil {
+		// Count the requested duration from when the request was made,
+		// in terms of STS's clock like the expirations it reports.
+		expiration := start.Add(p.skew + duration)
+		role.Credentials.Expiration = &expiration
+	}
+	p.lastRefresh = time.Now()
+	p.lastErr = nil
+	p.consecutiveFailures = 0
+	p.refreshes++
+	p.alerted = false
+
+	// Schedule next refresh ExpiryWindow before the credentials are due to expire.
+	// A client may have issued a shorter session than requested, leaving less than
+	// ExpiryWindow: refresh halfway through it then, rather than straight away.
+	now := time.Now()
+	p.nextRefresh = p.expiration().Add(-p.expiryWindow())
+	if p.nextRefresh.Before(now) {
+		p.nextRefresh = now.Add(p.expiration().Sub(now) / 2)
+	}
+
+	p.metrics.recordRefresh(p.expiration())
+	p.emit(Event{Type: EventRefreshed, Expiration: p.expiration()})
+	dotEnv, expiry := p.dotEnv(), p.expiration()
+	events := p.unlockQueued()
+
+	// Written once mu is released so that readers are not held up by disk I/O,
+	// but still under refreshMu so that the file always ends up with the latest session.
+	p.writeDotEnv(dotEnv, expiry)
+	return events, nil
+}
+
+// Build the AssumeRoleInput from the configuration and call STS.
+// If date is not nil, the default client records the response's Date header in it.
+func (p *TempCredentialsProvider) assume(duration time.Duration, date *responseDate) (*sts.AssumeRoleOutput, error) {
+	if p.InMemoryOnly && p.DotEnvPath != "" {
+		return nil, errors.New("DotEnvPath would write credentials to disk, but InMemoryOnly is set")
+	}
+
+	client := p.Client
+	if client == nil {
+		var err error
+		client, err = p.stsClient(date)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sessionName := p.RoleSessionName
+	if sessionName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "unknown"
+		}
+		sessionName = fmt.Sprintf("temp-%s-%d", hostname, time.Now().Unix())
+	}
+
+	input := &sts.AssumeRoleInput{
+		DurationSeconds: aws.Long(int64(duration / time.Second)),
 		RoleARN:         aws.String(p.RoleARN),
-		RoleSessionName: aws.String(fmt.Sprintf("temp-%s-%d", hostname, time.Now().Unix())),
-	})
+		RoleSessionName: aws.String(sessionName),
+	}
 
-	return err
+	externalID := p.ExternalID
+	if p.ExternalIDProvider != nil {
+		var err error
+		externalID, err = p.ExternalIDProvider()
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain external ID: %s", err)
+		}
+	}
+	if externalID != "" {
+		input.ExternalID = aws.String(externalID)
+	}
+
+	if p.SerialNumber != "" {
+		if p.TokenProvider == nil {
+			return nil, errors.New("SerialNumber is set, but there is no TokenProvider")
+		}
+		code, err := p.TokenProvider()
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain MFA token code: %s", err)
+		}
+		input.SerialNumber = aws.String(p.SerialNumber)
+		input.TokenCode = aws.String(code)
+	}
+
+	return p.assumeRole(client, input)
 }
 
-// Transforms the temporary sts.Credentials stored in the role into proper aws.Credentials.
-func (p *TempCredentialsProvider) Credentials() (*aws.Credentials, error) {
-	if time.Now().After(p.nextRefresh) {
-		err := p.Refresh()
+// Delay before retrying a failed background refresh,
+// doubling with each consecutive failure.
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+)
+
+// When to retry after a failed refresh: back off so that callers of
+// Credentials do not hammer STS, but never beyond the expiry of the
+// current credentials. Called with mu held.
+func (p *TempCredentialsProvider) retryAt() time.Time {
+	delay := minRetryDelay
+	for i := 1; i < p.consecutiveFailures && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	retry := time.Now().Add(delay)
+	if expiry := p.expiration(); retry.After(expiry) {
+		return expiry
+	}
+	return retry
+}
+
+// Shortest and longest sessions STS will issue. The maximum
+// also depends on the role's own MaxSessionDuration setting.
+const (
+	minDuration = 900 * time.Second
+	maxDuration = 12 * time.Hour
+)
+
+func (p *TempCredentialsProvider) sessionDuration() (time.Duration, error) {
+	duration := p.Duration
+	if p.DurationProvider != nil {
+		duration = p.DurationProvider()
+	}
+
+	if duration < minDuration || duration > maxDuration {
+		return 0, fmt.Errorf("session duration %s is outside of the %s to %s range allowed by STS", duration, minDuration, maxDuration)
+	}
+	if duration <= p.expiryWindow() {
+		return 0, fmt.Errorf("session duration %s must be longer than the %s ExpiryWindow", duration, p.expiryWindow())
+	}
+	return duration, nil
+}
+
+// Validate checks that the role can be assumed with the current configuration.
+// The session obtained is as short as STS allows and is discarded immediately,
+// so that deployment pipelines can assert assumability without leaving
+// usable credentials around.
+func (p *TempCredentialsProvider) Validate(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	role, err := p.assume(minDuration, nil)
+	if err != nil {
+		return err
+	}
+	return checkCredentials(role)
+}
+
+// Clients other than STS itself may return incomplete output,
+// which would otherwise only surface as a panic in setRole.
+func checkCredentials(role *sts.AssumeRoleOutput) error {
+	if role == nil || role.Credentials == nil || role.Credentials.AccessKeyID == nil ||
+		role.Credentials.SecretAccessKey == nil || role.Credentials.SessionToken == nil {
+		return errors.New("STS returned incomplete credentials")
+	}
+	return nil
+}
+
+// Store the new role, transposing its temporary sts.Credentials into
+// aws.Credentials once, so that Credentials does not allocate on every call.
+func (p *TempCredentialsProvider) setRole(role *sts.AssumeRoleOutput) {
+	p.recordReplaced()
+	p.expiringSoon = false
+	p.role = role
+	p.creds = &aws.Credentials{
+		AccessKeyID:     *role.Credentials.AccessKeyID,
+		SecretAccessKey: *role.Credentials.SecretAccessKey,
+		SessionToken:    *role.Credentials.SessionToken,
+	}
+}
+
+func (p *TempCredentialsProvider) stsClient(date *responseDate) (*sts.STS, error) {
+	region, err := p.stsRegion()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &aws.Config{
+		Region: region,
+	}
+	if p.EndpointResolver != nil {
+		config.Endpoint, err = p.EndpointResolver("sts", region)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve STS endpoint: %s", err)
+		}
+	}
+
+	stsClient := sts.New(config)
+
+	if p.AppID != "" {
+		// Runs after the SDK has set its own User-Agent during Build.
+		stsClient.Handlers.Build.PushBack(func(r *aws.Request) {
+			r.HTTPRequest.Header.Set("User-Agent", r.HTTPRequest.Header.Get("User-Agent")+" "+p.AppID)
+		})
+	}
+
+	if date != nil {
+		stsClient.Handlers.UnmarshalMeta.PushBack(func(r *aws.Request) {
+			if r.HTTPResponse != nil {
+				date.record(r.HTTPResponse.Header.Get("Date"), time.Now())
+			}
+		})
+	}
+
+	return stsClient, nil
+}
+
+// Assume the first candidate role that does not deny access.
+func (p *TempCredentialsProvider) assumeRole(client AssumeRoler, input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	candidates := append([]string{p.RoleARN}, p.FallbackRoleARNs...)
+
+	var err error
+	for _, roleARN := range candidates {
+		input.RoleARN = aws.String(roleARN)
+
+		// Rendered for each candidate, as PolicyData describes the role being assumed.
+		input.Policy, err = p.packedSessionPolicy(roleARN)
 		if err != nil {
-			// Retry next time around - don't wait for p.Duration to elapse.
-			log.Printf("TempCredentialsProvider failed to refresh credentials: %s\n", err)
 			return nil, err
 		}
 
-		// Schedule next refresh 5 minutes before the credentials are due to expire.
-		p.nextRefresh = time.Now().Add(p.Duration - (5 * time.Minute))
+		p.Budget.wait()
+		if p.BeforeAssumeRole != nil {
+			p.BeforeAssumeRole(input)
+		}
+
+		var role *sts.AssumeRoleOutput
+		role, err = client.AssumeRole(input)
+		if p.AfterAssumeRole != nil {
+			p.AfterAssumeRole(role, err)
+		}
+		p.audit(input, role, err)
+		if err == nil {
+			return role, nil
+		}
+		if isThrottling(err) {
+			p.Budget.throttled()
+		}
+		if !isAccessDenied(err) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+func isAccessDenied(err error) bool {
+	apiErr := aws.Error(err)
+	return apiErr != nil && apiErr.Code == "AccessDenied"
+}
+
+func (p *TempCredentialsProvider) expiryWindow() time.Duration {
+	if p.ExpiryWindow > 0 {
+		return p.ExpiryWindow
+	}
+	return defaultExpiryWindow
+}
+
+// Expiration of the current role according to the local clock. If STS did
+// not report one, refresh has filled it in from the requested duration.
+func (p *TempCredentialsProvider) expiration() time.Time {
+	if p.role == nil || p.role.Credentials == nil || p.role.Credentials.Expiration == nil {
+		return time.Time{}
+	}
+	return p.role.Credentials.Expiration.Add(-p.skew)
+}
+
+// AssumedRoleARN returns the ARN of the current session,
+// i.e. arn:aws:sts::<account>:assumed-role/<role>/<session name>.
+// It is empty until the role has been assumed.
+func (p *TempCredentialsProvider) AssumedRoleARN() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.assumedRoleARN()
+}
+
+func (p *TempCredentialsProvider) assumedRoleARN() string {
+	if p.role == nil || p.role.AssumedRoleUser == nil || p.role.AssumedRoleUser.ARN == nil {
+		return ""
+	}
+	return *p.role.AssumedRoleUser.ARN
+}
+
+// AssumedRoleID returns the unique identifier of the current session,
+// i.e. <role id>:<session name>. It is empty until the role has been assumed.
+func (p *TempCredentialsProvider) AssumedRoleID() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.role == nil || p.role.AssumedRoleUser == nil || p.role.AssumedRoleUser.AssumedRoleID == nil {
+		return ""
+	}
+	return *p.role.AssumedRoleUser.AssumedRoleID
+}
+
+// AccountID returns the ID of the account the current session belongs to,
+// as reported by STS. It is empty until the role has been assumed.
+func (p *TempCredentialsProvider) AccountID() string {
+	accountID, _ := p.assumedRoleFields()
+	return accountID
+}
+
+// RoleName returns the name of the role the current session was assumed from,
+// as reported by STS. It is empty until the role has been assumed.
+func (p *TempCredentialsProvider) RoleName() string {
+	_, roleName := p.assumedRoleFields()
+	return roleName
+}
+
+// Split arn:aws:sts::<account>:assumed-role/<role>/<session name>.
+func (p *TempCredentialsProvider) assumedRoleFields() (accountID, roleName string) {
+	fields := strings.SplitN(p.AssumedRoleARN(), ":", 6)
+	if len(fields) != 6 {
+		return "", ""
 	}
 
-	// Transpose the temporary sts.Credentials into aws.Credentials.
-	return &aws.Credentials{
-		AccessKeyID:     *p.role.Credentials.AccessKeyID,
-		SecretAccessKey: *p.role.Credentials.SecretAccessKey,
-		SessionToken:    *p.role.Credentials.SessionToken,
-	}, nil
+	resource := strings.Split(fields[5], "/")
+	if len(resource) != 3 || resource[0] != "assumed-role" {
+		return fields[4], ""
+	}
+	return fields[4], resource[1]
+}
+
+// ExpiresAt returns when the current credentials expire, according to the
+// local clock. It satisfies the SDK's credentials.Expirer interface.
+func (p *TempCredentialsProvider) ExpiresAt() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.expiration()
+}
+
+// Returns the credentials of the current role. Once they are due for a refresh,
+// they keep being returned while a new role is assumed in the background;
+// callers only wait for STS if the credentials have actually expired.
+//
+// The returned value is shared between callers and must not be modified.
+func (p *TempCredentialsProvider) Credentials() (*aws.Credentials, error) {
+	p.mu.Lock()
+	if p.lasts(0) {
+		if !time.Now().Before(p.nextRefresh) {
+			p.emitExpiringSoon()
+			if !p.refreshing {
+				p.refreshing = true
+				go p.refreshAsync()
+			}
+		}
+
+		creds := p.creds
+		p.recordUse()
+		p.unlock()
+		return creds, nil
+	}
+	p.countUnused(false)
+	p.mu.Unlock()
+
+	err := p.refreshUnless(func() bool { return p.lasts(0) })
+	if err != nil {
+		// Retry next time around - don't wait for p.Duration to elapse.
+		p.mu.Lock()
+		p.logEvent("error", "refresh-failed", err, p.expiration(), "TempCredentialsProvider failed to refresh credentials: %s\n", err)
+		p.unlock()
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recordUse()
+	return p.creds, nil
+}
+
+// Report whether the current credentials remain valid for at least ttl.
+// Called with mu held.
+func (p *TempCredentialsProvider) lasts(ttl time.Duration) bool {
+	return p.creds != nil && time.Until(p.expiration()) >= ttl
+}
+
+// Refresh, unless fresh reports that a concurrent refresh has already
+// done the job while we were waiting for refreshMu. fresh is called with mu held.
+func (p *TempCredentialsProvider) refreshUnless(fresh func() bool) error {
+	p.refreshMu.Lock()
+
+	p.mu.Lock()
+	done := fresh()
+	p.mu.Unlock()
+	if done {
+		p.refreshMu.Unlock()
+		return nil
+	}
+
+	events, err := p.refresh()
+	p.refreshMu.Unlock()
+
+	p.deliver(events)
+	return err
+}
+
+func (p *TempCredentialsProvider) refreshAsync() {
+	err := p.refreshUnless(func() bool { return time.Now().Before(p.nextRefresh) })
+
+	p.mu.Lock()
+	defer p.unlock()
+	p.refreshing = false
+	if err != nil {
+		// The current credentials are still valid, retry once refresh's backoff has elapsed.
+		p.logEvent("warning", "refresh-failed", err, p.expiration(), "TempCredentialsProvider failed to refresh credentials: %s\n", err)
+	}
+}
+
+// Lease returns credentials guaranteed to stay valid for at least minTTL,
+// along with their actual expiry. If the current role would not last that
+// long, a new one is assumed straight away.
+func (p *TempCredentialsProvider) Lease(ctx context.Context, minTTL time.Duration) (*aws.Credentials, time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	p.mu.Lock()
+	lasts := p.lasts(minTTL)
+	p.mu.Unlock()
+
+	if !lasts {
+		err := p.refreshUnless(func() bool { return p.lasts(minTTL) })
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+
+	p.mu.Lock()
+	creds, expiry := p.creds, p.expiration()
+	p.recordUse()
+	p.mu.Unlock()
+
+	if time.Until(expiry) < minTTL {
+		return nil, time.Time{}, fmt.Errorf("credentials expire at %s, sooner than the requested %s", expiry, minTTL)
+	}
+
+	return creds, expiry, nil
+}
+
+// AWSConfig returns a config for constructing service clients
+// that obtain their credentials from this provider. Its region is Region,
+// left empty for the SDK to resolve if Region is not set.
+func (p *TempCredentialsProvider) AWSConfig() *aws.Config {
+	return &aws.Config{
+		Region:      p.Region,
+		Credentials: p,
+	}
 }
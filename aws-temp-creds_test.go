@@ -0,0 +1,186 @@
+package awstempcreds
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/service/sts"
+)
+
+const testRoleARN = "arn:aws:iam::123456789012:role/test"
+
+// fakeSTS issues sessions of the requested duration, or fails with err once set.
+type fakeSTS struct {
+	mu    sync.Mutex
+	calls int
+	err   error
+	// Leave out the expiration, as some STS proxies do.
+	noExpiration bool
+	// If set, sessions last this long instead of the requested duration.
+	sessionLength time.Duration
+}
+
+func (f *fakeSTS) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	expiration := time.Now().Add(time.Duration(*input.DurationSeconds) * time.Second)
+	if f.sessionLength > 0 {
+		expiration = time.Now().Add(f.sessionLength)
+	}
+	output := &sts.AssumeRoleOutput{
+		AssumedRoleUser: &sts.AssumedRoleUser{
+			ARN:           aws.String("arn:aws:sts::123456789012:assumed-role/test/" + *input.RoleSessionName),
+			AssumedRoleID: aws.String("AROATEST:" + *input.RoleSessionName),
+		},
+		Credentials: &sts.Credentials{
+			AccessKeyID:     aws.String("ASIATEST"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      &expiration,
+		},
+	}
+	if f.noExpiration {
+		output.Credentials.Expiration = nil
+	}
+	return output, nil
+}
+
+func (f *fakeSTS) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *fakeSTS) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func newTestProvider(client AssumeRoler) *TempCredentialsProvider {
+	return &TempCredentialsProvider{
+		RoleARN:  testRoleARN,
+		Duration: time.Hour,
+		Client:   client,
+	}
+}
+
+type incompleteSTS struct{}
+
+func (incompleteSTS) AssumeRole(*sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	return &sts.AssumeRoleOutput{Credentials: &sts.Credentials{AccessKeyID: aws.String("ASIATEST")}}, nil
+}
+
+func TestIncompleteCredentials(t *testing.T) {
+	p := newTestProvider(incompleteSTS{})
+	if _, err := p.Credentials(); err == nil {
+		t.Fatal("expected an error for incomplete credentials")
+	}
+}
+
+func TestMissingExpiration(t *testing.T) {
+	client := &fakeSTS{noExpiration: true}
+	p := &TempCredentialsProvider{
+		RoleARN:          testRoleARN,
+		DurationProvider: func() time.Duration { return time.Hour },
+		Client:           client,
+	}
+
+	start := time.Now()
+	if _, err := p.Credentials(); err != nil {
+		t.Fatal(err)
+	}
+	expiry := p.ExpiresAt()
+	if expiry.Before(start.Add(time.Hour)) || expiry.After(time.Now().Add(time.Hour)) {
+		t.Errorf("got expiry %s, want an hour after %s", expiry, start)
+	}
+
+	if _, err := p.Credentials(); err != nil {
+		t.Fatal(err)
+	}
+	if n := client.callCount(); n != 1 {
+		t.Errorf("got %d AssumeRole calls, want 1", n)
+	}
+	if _, _, err := p.Lease(context.Background(), 2*time.Hour); err == nil {
+		t.Error("expected Lease to fail beyond the session duration")
+	}
+}
+
+func BenchmarkCredentials(b *testing.B) {
+	p := newTestProvider(&fakeSTS{})
+	if _, err := p.Credentials(); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := p.Credentials(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestCredentialsDoesNotAllocate(t *testing.T) {
+	p := newTestProvider(&fakeSTS{})
+	if _, err := p.Credentials(); err != nil {
+		t.Fatal(err)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		p.Credentials()
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocations per call, want 0", allocs)
+	}
+}
+
+func TestRefreshBackoff(t *testing.T) {
+	client := &fakeSTS{}
+	p := newTestProvider(client)
+	p.Duration = minDuration
+	p.ExpiryWindow = minDuration - 50*time.Millisecond
+	if err := p.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	client.fail(errors.New("unavailable"))
+	time.Sleep(100 * time.Millisecond)
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if _, err := p.Credentials(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The initial refresh, then a single background one before backing off.
+	if n := client.callCount(); n != 2 {
+		t.Errorf("got %d AssumeRole calls, want 2", n)
+	}
+}
+
+func TestAWSConfigRegion(t *testing.T) {
+	p := newTestProvider(&fakeSTS{})
+	p.RoleARN = "arn:aws-cn:iam::123456789012:role/test"
+	if region := p.AWSConfig().Region; region != "" {
+		t.Errorf("got region %q, want it left for the SDK to resolve", region)
+	}
+
+	p.Region = "cn-northwest-1"
+	if region := p.AWSConfig().Region; region != "cn-northwest-1" {
+		t.Errorf("got region %q, want Region", region)
+	}
+}
@@ -0,0 +1,114 @@
+package awstempcreds
+
+import (
+	"sync"
+	"time"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+)
+
+// Budget rate-limits STS calls. A single Budget can be shared between any
+// number of providers, so that together they stay within STS quotas instead
+// of each retrying independently. Budgets are created with NewBudget;
+// the zero value, like a nil *Budget, does not limit anything.
+type Budget struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	waits  int
+	waited time.Duration
+}
+
+// NewBudget allows perSecond STS calls on average, with bursts of up to burst calls.
+// Like time.NewTicker, it panics if perSecond is not positive,
+// and likewise if burst is negative.
+func NewBudget(perSecond float64, burst int) *Budget {
+	if !(perSecond > 0) {
+		panic("awstempcreds: non-positive rate for NewBudget")
+	}
+	if burst < 0 {
+		panic("awstempcreds: negative burst for NewBudget")
+	}
+	return &Budget{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Block until an STS call may be made.
+func (b *Budget) wait() {
+	if b.unlimited() {
+		return
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	// Reserve a token, going into debt if there are none left.
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+		b.waits++
+		b.waited += delay
+	}
+	b.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// Called when STS reports throttling: drop any accumulated burst so that
+// all sharing providers slow down to the sustained rate.
+func (b *Budget) throttled() {
+	if b.unlimited() {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens > 0 {
+		b.tokens = 0
+	}
+}
+
+// A nil or zero Budget. rate is only set by NewBudget, so it is safe to read unlocked.
+func (b *Budget) unlimited() bool {
+	return b == nil || !(b.rate > 0)
+}
+
+// Waits returns how many STS calls were delayed by the budget.
+func (b *Budget) Waits() int {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.waits
+}
+
+// WaitTime returns the total time STS calls were delayed by the budget.
+func (b *Budget) WaitTime() time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.waited
+}
+
+func isThrottling(err error) bool {
+	apiErr := aws.Error(err)
+	return apiErr != nil && (apiErr.Code == "Throttling" || apiErr.Code == "ThrottlingException")
+}
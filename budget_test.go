@@ -0,0 +1,15 @@
+package awstempcreds
+
+import "testing"
+
+func TestZeroBudgetIsUnlimited(t *testing.T) {
+	for _, b := range []*Budget{nil, {}} {
+		for i := 0; i < 3; i++ {
+			b.wait()
+			b.throttled()
+		}
+		if n, d := b.Waits(), b.WaitTime(); n != 0 || d != 0 {
+			t.Errorf("got %d waits totalling %s, want none", n, d)
+		}
+	}
+}
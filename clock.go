@@ -0,0 +1,74 @@
+package awstempcreds
+
+import (
+	"net/http"
+	"time"
+)
+
+// Clock skew beyond which a warning is logged on each refresh.
+const skewWarningThreshold = time.Minute
+
+// Largest skew estimated from expirations that is believed. Expirations only
+// reveal the skew if the session lasts exactly as long as requested, which
+// proxies and other clients do not guarantee. It also bounds how much later
+// than reported by STS credentials may be considered to expire.
+const maxSkewEstimate = 5 * time.Minute
+
+// The Date header of an STS response, along with when it was received.
+type responseDate struct {
+	server time.Time
+	local  time.Time
+}
+
+func (d *responseDate) record(header string, received time.Time) {
+	server, err := http.ParseTime(header)
+	if err != nil {
+		return
+	}
+	// The header is truncated to the second, so it was sent half a second
+	// later on average.
+	d.server = server.Add(500 * time.Millisecond)
+	d.local = received
+}
+
+// Measure how far the local clock is behind STS's: from the Date header of
+// the response where available, or else from the expiration of a freshly
+// issued role, which STS sets to its own current time plus the requested
+// duration. The skew is then applied to all expiry checks, so that hosts
+// with drifted clocks neither refresh too early nor use expired credentials.
+// Called with mu held.
+func (p *TempCredentialsProvider) measureSkew(duration time.Duration, start, end time.Time, date responseDate) {
+	var skew time.Duration
+	switch {
+	case !date.server.IsZero():
+		skew = date.server.Sub(date.local)
+	case p.role.Credentials.Expiration != nil:
+		issued := p.role.Credentials.Expiration.Add(-duration)
+		local := start.Add(end.Sub(start) / 2)
+		skew = issued.Sub(local)
+		if skew > maxSkewEstimate || skew < -maxSkewEstimate {
+			// More likely a session shorter or longer than requested than a clock this far off.
+			skew = 0
+		}
+	default:
+		return
+	}
+
+	// Never consider credentials valid for much longer than STS said they are.
+	if skew < -maxSkewEstimate {
+		skew = -maxSkewEstimate
+	}
+	p.skew = skew
+
+	if p.skew > skewWarningThreshold || p.skew < -skewWarningThreshold {
+		p.logEvent("warning", "clock-skew", nil, p.expiration(), "TempCredentialsProvider detected local clock skew of %s against STS\n", -p.skew)
+	}
+}
+
+// ClockSkew returns how far ahead of STS the local clock was found to be at
+// the last refresh; negative values mean the local clock is behind.
+func (p *TempCredentialsProvider) ClockSkew() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return -p.skew
+}
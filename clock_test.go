@@ -0,0 +1,58 @@
+package awstempcreds
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// A session shorter than requested must not be mistaken for clock skew,
+// which would keep its credentials in use long after they have expired.
+func TestShortSession(t *testing.T) {
+	client := &fakeSTS{sessionLength: 10 * time.Minute}
+	p := newTestProvider(client)
+
+	start := time.Now()
+	if err := p.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if skew := p.ClockSkew(); skew != 0 {
+		t.Errorf("got clock skew %s, want 0", skew)
+	}
+	if expiry := p.ExpiresAt(); expiry.After(start.Add(10*time.Minute + time.Second)) {
+		t.Errorf("got expiry %s, want at most 10 minutes after %s", expiry, start)
+	}
+
+	p.mu.Lock()
+	nextRefresh := p.nextRefresh
+	p.mu.Unlock()
+	if want := start.Add(5 * time.Minute); nextRefresh.After(want.Add(time.Second)) || nextRefresh.Before(want) {
+		t.Errorf("got next refresh at %s, want ExpiryWindow before the expiry", nextRefresh)
+	}
+}
+
+func TestSkewFromDate(t *testing.T) {
+	p := newTestProvider(&fakeSTS{})
+	if err := p.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, tc := range []struct {
+		behind, want time.Duration
+	}{
+		{2 * time.Minute, -2 * time.Minute},
+		// The local clock being ahead may only extend the expiry so far.
+		{-time.Hour, maxSkewEstimate},
+	} {
+		var date responseDate
+		date.record(now.Add(tc.behind).UTC().Format(http.TimeFormat), now)
+
+		p.mu.Lock()
+		p.measureSkew(time.Hour, now, now, date)
+		p.mu.Unlock()
+		if skew := p.ClockSkew(); skew < tc.want-time.Second || skew > tc.want+time.Second {
+			t.Errorf("local clock %s behind: got clock skew %s, want %s", tc.behind, skew, tc.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package awstempcreds
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Codec serializes sessions for storage or handoff between processes.
+// Implement it to e.g. envelope-encrypt sessions with KMS.
+type Codec interface {
+	Encode(s *Session) ([]byte, error)
+	Decode(data []byte) (*Session, error)
+}
+
+// JSONCodec encodes sessions as plain JSON. It is used by Snapshot.
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(s *Session) ([]byte, error) {
+	return json.Marshal(s)
+}
+
+func (JSONCodec) Decode(data []byte) (*Session, error) {
+	var s Session
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GobCodec encodes sessions with encoding/gob.
+type GobCodec struct{}
+
+func (GobCodec) Encode(s *Session) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(s)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Decode(data []byte) (*Session, error) {
+	var s Session
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// EncryptedCodec seals the output of another codec (JSON by default) with
+// AES-GCM. Key must be 16, 24 or 32 bytes long.
+type EncryptedCodec struct {
+	Codec Codec
+	Key   []byte
+}
+
+func (c EncryptedCodec) inner() Codec {
+	if c.Codec == nil {
+		return JSONCodec{}
+	}
+	return c.Codec
+}
+
+func (c EncryptedCodec) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(c.Key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c EncryptedCodec) Encode(s *Session) ([]byte, error) {
+	plaintext, err := c.inner().Encode(s)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := c.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (c EncryptedCodec) Decode(data []byte) (*Session, error) {
+	aead, err := c.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted session is too short")
+	}
+
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.inner().Decode(plaintext)
+}
@@ -0,0 +1,48 @@
+package awstempcreds
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultDuration is the session duration used by NewCredentials,
+// matching stscreds.DefaultDuration.
+const DefaultDuration = 15 * time.Minute
+
+// NewCredentials follows the shape of stscreds.NewCredentials, to ease porting
+// call sites written against the SDK's stscreds package. It is not a drop-in
+// replacement, and ported call sites need the following changes:
+//
+//   - It takes a region rather than a client.ConfigProvider, and returns the
+//     provider itself rather than a *credentials.Credentials.
+//   - The options set fields of TempCredentialsProvider, where ExternalID,
+//     Policy and SerialNumber are strings rather than *string.
+//   - A zero ExpiryWindow means the 5 minute default rather than no window
+//     at all.
+//
+// Duration, RoleSessionName and TokenProvider carry over unchanged.
+func NewCredentials(region, roleARN string, options ...func(*TempCredentialsProvider)) *TempCredentialsProvider {
+	p := &TempCredentialsProvider{
+		Region:   region,
+		RoleARN:  roleARN,
+		Duration: DefaultDuration,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// StdinTokenProvider mirrors stscreds.StdinTokenProvider, prompting on stdout
+// and reading the MFA token code from stdin.
+func StdinTokenProvider() (string, error) {
+	fmt.Print("Assume Role MFA token code: ")
+	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(code), nil
+}
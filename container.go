@@ -0,0 +1,55 @@
+package awstempcreds
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Response format of the container credentials endpoint, as read by the SDKs.
+type containerCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+	Expiration      string `json:"Expiration"`
+	RoleARN         string `json:"RoleArn,omitempty"`
+}
+
+// ContainerCredentialsHandler serves the provider's credentials in the format
+// of the ECS container credentials endpoint, so that it can be mounted into
+// any mux and pointed at with AWS_CONTAINER_CREDENTIALS_FULL_URI.
+//
+// Requests must carry the given token in the Authorization header, as SDKs do
+// when AWS_CONTAINER_AUTHORIZATION_TOKEN is set. An empty token rejects all requests.
+func ContainerCredentialsHandler(p *TempCredentialsProvider, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if token == "" || subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		s, err := p.Session()
+		if err != nil {
+			// Don't leak STS error details to the caller.
+			p.logEvent("error", "container-credentials-failed", err, time.Time{}, "ContainerCredentialsHandler failed to obtain credentials: %s\n", err)
+			http.Error(w, "credentials unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&containerCredentials{
+			AccessKeyID:     s.AccessKeyID,
+			SecretAccessKey: s.SecretAccessKey,
+			Token:           s.SessionToken,
+			Expiration:      s.Expiration.UTC().Format(time.RFC3339),
+			RoleARN:         s.AssumedRoleARN,
+		})
+	})
+}
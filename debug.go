@@ -0,0 +1,93 @@
+package awstempcreds
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Status of a single provider as served by DebugHandler. Credentials are
+// never included, only the metadata describing them.
+type debugStatus struct {
+	Labels              map[string]string `json:"labels,omitempty"`
+	RoleARN             string            `json:"role_arn"`
+	AssumedRoleARN      string            `json:"assumed_role_arn,omitempty"`
+	Expiration          string            `json:"expiration,omitempty"`
+	Expired             bool              `json:"expired"`
+	LastRefresh         string            `json:"last_refresh,omitempty"`
+	LastError           string            `json:"last_error,omitempty"`
+	ConsecutiveFailures int               `json:"consecutive_failures"`
+	Overdue             string            `json:"overdue,omitempty"`
+}
+
+// DebugHandler serves the status of the Manager's providers as JSON, keyed by
+// name, so that operators can diagnose a wedged refresher without restarting
+// it. Secrets are never included. It is meant to be mounted on /debug/creds
+// of a mux served on a loopback-only listener, next to net/http/pprof if
+// profiles are wanted too:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/debug/creds", awstempcreds.DebugHandler(m))
+//	mux.HandleFunc("/debug/pprof/", pprof.Index)
+//	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+//	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+//	go http.ListenAndServe("localhost:6060", mux)
+//
+// As a safeguard, requests from non-loopback addresses are refused, as are
+// requests carrying X-Forwarded-For or Forwarded headers, which were relayed
+// by a proxy on the same host. Proxies that do not add those headers are
+// indistinguishable from local clients though, so this is no substitute
+// for the loopback listener.
+func DebugHandler(m *Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !isLoopback(r.RemoteAddr) || r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("Forwarded") != "" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		statuses := make(map[string]debugStatus)
+		for name, s := range m.Status() {
+			statuses[name] = newDebugStatus(s)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statuses)
+	})
+}
+
+func newDebugStatus(s ProviderStatus) debugStatus {
+	d := debugStatus{
+		Labels:              s.Labels,
+		RoleARN:             s.RoleARN,
+		AssumedRoleARN:      s.AssumedRoleARN,
+		Expired:             s.Expired,
+		ConsecutiveFailures: s.ConsecutiveFailures,
+	}
+	if !s.Expiration.IsZero() {
+		d.Expiration = s.Expiration.UTC().Format(time.RFC3339)
+	}
+	if !s.LastRefresh.IsZero() {
+		d.LastRefresh = s.LastRefresh.UTC().Format(time.RFC3339)
+	}
+	if s.LastError != nil {
+		d.LastError = s.LastError.Error()
+	}
+	if s.Overdue > 0 {
+		d.Overdue = s.Overdue.String()
+	}
+	return d
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
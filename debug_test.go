@@ -0,0 +1,54 @@
+package awstempcreds
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	m := &Manager{}
+	p := newTestProvider(&fakeSTS{})
+	m.Add("test", p)
+	if err := p.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	handler := DebugHandler(m)
+
+	req := httptest.NewRequest("GET", "/debug/creds", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d", rec.Code)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "secret") || strings.Contains(body, "token") {
+		t.Errorf("credentials leaked: %s", body)
+	}
+	var statuses map[string]debugStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if s := statuses["test"]; s.RoleARN != testRoleARN || s.AssumedRoleARN == "" || s.Expired {
+		t.Errorf("got status %+v", s)
+	}
+
+	req.RemoteAddr = "192.0.2.1:12345"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("got status %d for a remote client, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	// Relayed by a reverse proxy on the same host.
+	req.RemoteAddr = "127.0.0.1:12345"
+	req.Header.Set("X-Forwarded-For", "192.0.2.1")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("got status %d for a proxied client, want %d", rec.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,173 @@
+package awstempcreds
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/service/iam"
+)
+
+// AssumableRoles lists the ARNs of roles visible with the given config whose
+// trust policy allows callerARN to assume them. Pass a config with
+// credentials for another account to search that account instead.
+//
+// callerARN may be an IAM user or role ARN, or the ARN of an assumed role
+// session as returned by AssumedRoleARN, which matches principals naming
+// either the session itself or the role it was assumed from.
+//
+// Trust policy conditions (such as ExternalId or MFA requirements) are not
+// evaluated, so the result is a list of candidates rather than a guarantee.
+func AssumableRoles(config *aws.Config, callerARN string) ([]string, error) {
+	iamClient := iam.New(config)
+
+	var roleARNs []string
+	input := &iam.ListRolesInput{}
+	for {
+		out, err := iamClient.ListRoles(input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, role := range out.Roles {
+			if role.ARN == nil || role.AssumeRolePolicyDocument == nil {
+				continue
+			}
+			if trusts(*role.AssumeRolePolicyDocument, callerARN) {
+				roleARNs = append(roleARNs, *role.ARN)
+			}
+		}
+
+		if out.IsTruncated == nil || !*out.IsTruncated || out.Marker == nil {
+			return roleARNs, nil
+		}
+		input.Marker = out.Marker
+	}
+}
+
+// Policy document values may be given either as a single string or a list.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = stringList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+type trustStatement struct {
+	Effect    string
+	Action    stringList
+	Principal json.RawMessage
+}
+
+type trustPolicy struct {
+	Statement json.RawMessage
+}
+
+// Report whether the URL-encoded trust policy allows callerARN to call
+// sts:AssumeRole, taking explicit denies into account.
+func trusts(document, callerARN string) bool {
+	decoded, err := url.QueryUnescape(document)
+	if err != nil {
+		return false
+	}
+
+	var policy trustPolicy
+	if err := json.Unmarshal([]byte(decoded), &policy); err != nil {
+		return false
+	}
+
+	var statements []trustStatement
+	if err := json.Unmarshal(policy.Statement, &statements); err != nil {
+		var single trustStatement
+		if err := json.Unmarshal(policy.Statement, &single); err != nil {
+			return false
+		}
+		statements = []trustStatement{single}
+	}
+
+	allowed := false
+	for _, st := range statements {
+		if !allowsAssumeRole(st.Action) || !principalMatches(st.Principal, callerARN) {
+			continue
+		}
+		if st.Effect == "Deny" {
+			return false
+		}
+		if st.Effect == "Allow" {
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+func allowsAssumeRole(actions stringList) bool {
+	for _, action := range actions {
+		switch strings.ToLower(action) {
+		case "sts:assumerole", "sts:*", "*":
+			return true
+		}
+	}
+	return false
+}
+
+func principalMatches(raw json.RawMessage, callerARN string) bool {
+	var wildcard string
+	if err := json.Unmarshal(raw, &wildcard); err == nil {
+		return wildcard == "*"
+	}
+
+	var principal struct {
+		AWS stringList
+	}
+	if err := json.Unmarshal(raw, &principal); err != nil {
+		return false
+	}
+
+	accountID := ""
+	if fields := strings.Split(callerARN, ":"); len(fields) > 4 {
+		accountID = fields[4]
+	}
+
+	role, isSession := sessionRole(callerARN)
+	for _, p := range principal.AWS {
+		switch {
+		case p == "*", p == callerARN:
+			return true
+		case accountID != "" && (p == accountID || strings.HasSuffix(p, ":"+accountID+":root")):
+			return true
+		case isSession && isRole(p, role):
+			return true
+		}
+	}
+	return false
+}
+
+// The role arn:aws:sts::<account>:assumed-role/<role>/<session name> was
+// assumed from. Session ARNs do not include the role's path, so it is left empty.
+func sessionRole(arn string) (ParsedRoleARN, bool) {
+	fields := strings.SplitN(arn, ":", 6)
+	if len(fields) != 6 || fields[0] != "arn" || fields[2] != "sts" {
+		return ParsedRoleARN{}, false
+	}
+	resource := strings.Split(fields[5], "/")
+	if len(resource) != 3 || resource[0] != "assumed-role" {
+		return ParsedRoleARN{}, false
+	}
+	return ParsedRoleARN{Partition: fields[1], AccountID: fields[4], Name: resource[1]}, true
+}
+
+// Report whether principal is the ARN of role, whatever its path.
+func isRole(principal string, role ParsedRoleARN) bool {
+	a, err := ParseRoleARN(principal)
+	return err == nil && a.Partition == role.Partition && a.AccountID == role.AccountID && a.Name == role.Name
+}
@@ -0,0 +1,28 @@
+package awstempcreds
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestTrustsSessionOfTrustedRole(t *testing.T) {
+	document := url.QueryEscape(`{
+		"Version": "2012-10-17",
+		"Statement": [{
+			"Effect": "Allow",
+			"Principal": {"AWS": "arn:aws:iam::123456789012:role/ci/deployer"},
+			"Action": "sts:AssumeRole"
+		}]
+	}`)
+
+	for callerARN, want := range map[string]bool{
+		"arn:aws:iam::123456789012:role/ci/deployer":                 true,
+		"arn:aws:sts::123456789012:assumed-role/deployer/build-1234": true,
+		"arn:aws:sts::123456789012:assumed-role/other/build-1234":    false,
+		"arn:aws:sts::210987654321:assumed-role/deployer/build-1234": false,
+	} {
+		if got := trusts(document, callerARN); got != want {
+			t.Errorf("trusts(%s) = %v, want %v", callerARN, got, want)
+		}
+	}
+}
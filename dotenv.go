@@ -0,0 +1,65 @@
+package awstempcreds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The contents of DotEnvPath for the current credentials, or nil if it is not set.
+// Called with mu held.
+func (p *TempCredentialsProvider) dotEnv() []byte {
+	if p.DotEnvPath == "" {
+		return nil
+	}
+
+	return []byte(fmt.Sprintf(
+		"AWS_ACCESS_KEY_ID=%s\nAWS_SECRET_ACCESS_KEY=%s\nAWS_SESSION_TOKEN=%s\nAWS_CREDENTIAL_EXPIRATION=%s\n",
+		p.creds.AccessKeyID,
+		p.creds.SecretAccessKey,
+		p.creds.SessionToken,
+		p.expiration().UTC().Format(time.RFC3339),
+	))
+}
+
+// Write the contents produced by dotEnv to DotEnvPath. The file is replaced
+// atomically, so readers never see it half-written, and is only readable
+// by its owner. Failures are logged rather than failing the refresh.
+// Called with refreshMu held, but not mu.
+func (p *TempCredentialsProvider) writeDotEnv(data []byte, expiry time.Time) {
+	if data == nil {
+		return
+	}
+
+	err := writeFileAtomic(p.DotEnvPath, data)
+	if err != nil {
+		p.logEvent("error", "dotenv-failed", err, expiry, "TempCredentialsProvider failed to write %s: %s\n", p.DotEnvPath, err)
+	}
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// TempFile already creates the file with 0600, but be explicit about it.
+	err = tmp.Chmod(0600)
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
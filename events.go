@@ -0,0 +1,183 @@
+package awstempcreds
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies a credential lifecycle event.
+type EventType int
+
+const (
+	// New credentials have been obtained.
+	EventRefreshed EventType = iota
+	// An attempt to obtain new credentials has failed.
+	EventRefreshFailed
+	// The current credentials have entered the ExpiryWindow and are due
+	// for a refresh. Raised once per session.
+	EventExpiringSoon
+	// A refresh has failed, and the current credentials have expired.
+	EventExpired
+	// Refreshes keep failing and the current credentials expire within
+	// ExpiryAlertThreshold. Raised once per session; this is the one to page on.
+	EventExpiryImminent
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventRefreshed:
+		return "refreshed"
+	case EventRefreshFailed:
+		return "refresh-failed"
+	case EventExpiringSoon:
+		return "expiring-soon"
+	case EventExpired:
+		return "expired"
+	case EventExpiryImminent:
+		return "expiry-imminent"
+	}
+	return "unknown"
+}
+
+// Event describes a change in the state of the provider's credentials.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Name and Labels of the provider raising the event.
+	Name   string
+	Labels map[string]string
+	// Expiration of the credentials held at the time of the event.
+	Expiration time.Time
+	// Err is set for failure events.
+	Err error
+	// ConsecutiveFailures counts the refreshes failed since the last success.
+	ConsecutiveFailures int
+}
+
+type subscription struct {
+	id    int
+	types []EventType
+	fn    func(Event)
+}
+
+func (s *subscription) wants(t EventType) bool {
+	if len(s.types) == 0 {
+		return true
+	}
+	for _, st := range s.types {
+		if st == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribers are guarded by a mutex so that independent components
+// can subscribe from their own goroutines.
+type eventBus struct {
+	mu     sync.Mutex
+	nextID int
+	subs   []subscription
+}
+
+func (b *eventBus) emit(e Event) {
+	b.mu.Lock()
+	subs := make([]subscription, len(b.subs))
+	copy(subs, b.subs)
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		if s.wants(e.Type) {
+			s.fn(e)
+		}
+	}
+}
+
+// Subscribe registers fn to be called synchronously for each event of the
+// given types, or for all events if none are given. The returned id can be
+// passed to Unsubscribe.
+func (p *TempCredentialsProvider) Subscribe(fn func(Event), types ...EventType) int {
+	b := &p.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	b.subs = append(b.subs, subscription{id: b.nextID, types: types, fn: fn})
+	return b.nextID
+}
+
+// Unsubscribe removes the subscription with the given id.
+func (p *TempCredentialsProvider) Unsubscribe(id int) {
+	b := &p.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, s := range b.subs {
+		if s.id == id {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Queue an event for delivery once p.mu is released.
+func (p *TempCredentialsProvider) emit(e Event) {
+	e.Time = time.Now()
+	e.Name = p.Name
+	e.Labels = p.Labels
+	e.ConsecutiveFailures = p.consecutiveFailures
+	p.queued = append(p.queued, e)
+}
+
+// Release p.mu, then deliver the events queued while it was held,
+// so that subscribers are free to call back into the provider.
+// Must not be called while holding refreshMu, see unlockQueued.
+func (p *TempCredentialsProvider) unlock() {
+	p.deliver(p.unlockQueued())
+}
+
+// Release p.mu, handing back the events queued while it was held.
+// Used under refreshMu, whose holder delivers them once it is released.
+func (p *TempCredentialsProvider) unlockQueued() []Event {
+	queued := p.queued
+	p.queued = nil
+	p.mu.Unlock()
+	return queued
+}
+
+func (p *TempCredentialsProvider) deliver(events []Event) {
+	for _, e := range events {
+		p.events.emit(e)
+	}
+}
+
+// Raise EventExpiringSoon the first time the current credentials are found
+// within the ExpiryWindow. Called with mu held.
+func (p *TempCredentialsProvider) emitExpiringSoon() {
+	if p.creds == nil || p.expiringSoon {
+		return
+	}
+	expiry := p.expiration()
+	if time.Until(expiry) > p.expiryWindow() {
+		return
+	}
+
+	p.expiringSoon = true
+	p.emit(Event{Type: EventExpiringSoon, Expiration: expiry})
+}
+
+// Report whether the role held after a failed refresh is still usable.
+func (p *TempCredentialsProvider) emitExpiry(err error) {
+	expiry := p.expiration()
+	if !time.Now().Before(expiry) {
+		p.emit(Event{Type: EventExpired, Expiration: expiry, Err: err})
+		return
+	}
+
+	p.emitExpiringSoon()
+	if p.ExpiryAlertThreshold > 0 && !p.alerted && time.Until(expiry) < p.ExpiryAlertThreshold {
+		p.alerted = true
+		p.logEvent("critical", "expiry-imminent", err, expiry, "TempCredentialsProvider credentials expire at %s and refreshes keep failing: %s\n", expiry, err)
+		p.emit(Event{Type: EventExpiryImminent, Expiration: expiry, Err: err})
+	}
+}
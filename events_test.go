@@ -0,0 +1,73 @@
+package awstempcreds
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Subscribers are called once refreshMu is released,
+// so they may refresh the provider themselves.
+func TestSubscriberCanRefresh(t *testing.T) {
+	client := &fakeSTS{err: errors.New("unavailable")}
+	p := newTestProvider(client)
+
+	p.Subscribe(func(e Event) {
+		client.fail(nil)
+		if err := p.Refresh(); err != nil {
+			t.Errorf("Refresh from subscriber: %s", err)
+		}
+		if _, _, err := p.Lease(context.Background(), time.Minute); err != nil {
+			t.Errorf("Lease from subscriber: %s", err)
+		}
+	}, EventRefreshFailed)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := p.Refresh(); err == nil {
+			t.Error("expected the first refresh to fail")
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber deadlocked")
+	}
+	if n := client.callCount(); n != 2 {
+		t.Errorf("got %d AssumeRole calls, want 2", n)
+	}
+}
+
+func TestExpiringSoon(t *testing.T) {
+	client := &fakeSTS{}
+	p := newTestProvider(client)
+	p.Duration = minDuration
+	p.ExpiryWindow = minDuration - 50*time.Millisecond
+
+	events := make(chan Event, 10)
+	p.Subscribe(func(e Event) {
+		events <- e
+	}, EventExpiringSoon)
+
+	if err := p.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatal("expiring-soon raised by a fresh session")
+	}
+
+	// Keep the session in the ExpiryWindow by failing the background refreshes.
+	client.fail(errors.New("unavailable"))
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if _, err := p.Credentials(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(events); n != 1 {
+		t.Errorf("got %d expiring-soon events, want 1", n)
+	}
+}
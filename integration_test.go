@@ -0,0 +1,96 @@
+//go:build integration
+// +build integration
+
+// Integration tests against LocalStack, run with
+//
+//	AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test go test -tags integration
+//
+// LOCALSTACK_ENDPOINT overrides the default endpoint of http://localhost:4566.
+
+package awstempcreds
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newLocalStackProvider(t *testing.T) *TempCredentialsProvider {
+	endpoint := os.Getenv("LOCALSTACK_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://localhost:4566"
+	}
+
+	return &TempCredentialsProvider{
+		Name:     t.Name(),
+		Region:   "us-east-1",
+		Duration: time.Hour,
+		// LocalStack does not enforce trust policies, so the role need not exist.
+		RoleARN: "arn:aws:iam::000000000000:role/integration",
+		EndpointResolver: func(service, region string) (string, error) {
+			return endpoint, nil
+		},
+	}
+}
+
+func TestIntegrationCredentials(t *testing.T) {
+	p := newLocalStackProvider(t)
+
+	creds, err := p.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" || creds.SessionToken == "" {
+		t.Fatalf("got incomplete credentials %+v", creds)
+	}
+	if !strings.Contains(p.AssumedRoleARN(), ":assumed-role/integration/") {
+		t.Errorf("got assumed role ARN %q", p.AssumedRoleARN())
+	}
+	if expiry := p.ExpiresAt(); time.Until(expiry) < 55*time.Minute {
+		t.Errorf("got expiry %s, want about an hour from now", expiry)
+	}
+
+	// Served from memory until due for a refresh.
+	again, err := p.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != creds {
+		t.Error("credentials were refreshed before they were due")
+	}
+}
+
+func TestIntegrationRefresh(t *testing.T) {
+	p := newLocalStackProvider(t)
+
+	refreshed := make(chan Event, 2)
+	p.Subscribe(func(e Event) {
+		refreshed <- e
+	}, EventRefreshed)
+
+	for i := 0; i < 2; i++ {
+		if err := p.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(refreshed); n != 2 {
+		t.Errorf("got %d refreshed events, want 2", n)
+	}
+	if n := p.RefreshCount(); n != 2 {
+		t.Errorf("got a refresh count of %d, want 2", n)
+	}
+}
+
+func TestIntegrationValidate(t *testing.T) {
+	p := newLocalStackProvider(t)
+
+	if err := p.Validate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Validate discards the session it obtains.
+	if arn := p.AssumedRoleARN(); arn != "" {
+		t.Errorf("got assumed role ARN %q after Validate, want none", arn)
+	}
+}
@@ -0,0 +1,71 @@
+package awstempcreds
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+)
+
+type logEntry struct {
+	Time       string            `json:"time"`
+	Level      string            `json:"level"`
+	Name       string            `json:"name,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	RoleARN    string            `json:"role_arn"`
+	Event      string            `json:"event"`
+	Error      string            `json:"error,omitempty"`
+	ErrorClass string            `json:"error_class,omitempty"`
+	Expiry     string            `json:"expiry,omitempty"`
+}
+
+// Serialises the package's log writes: JSON lines bypass the standard
+// logger's own mutex so as not to be prefixed, and its output may not be
+// goroutine-safe.
+var logMu sync.Mutex
+
+// Log an event through the standard logger: as a JSON line if JSONLogging
+// is set, or as the free-text message otherwise. A zero expiry is omitted.
+func (p *TempCredentialsProvider) logEvent(level, event string, err error, expiry time.Time, format string, v ...interface{}) {
+	if !p.JSONLogging {
+		if p.Name != "" {
+			// The name is an argument, so that a % in it is printed as is.
+			format = "%s: " + format
+			v = append([]interface{}{p.Name}, v...)
+		}
+		logMu.Lock()
+		defer logMu.Unlock()
+		log.Printf(format, v...)
+		return
+	}
+
+	entry := logEntry{
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Level:   level,
+		Name:    p.Name,
+		Labels:  p.Labels,
+		RoleARN: p.RoleARN,
+		Event:   event,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		entry.ErrorClass = "internal"
+		if apiErr := aws.Error(err); apiErr != nil {
+			entry.ErrorClass = apiErr.Code
+		}
+	}
+	if !expiry.IsZero() {
+		entry.Expiry = expiry.UTC().Format(time.RFC3339)
+	}
+
+	line, err := json.Marshal(&entry)
+	logMu.Lock()
+	defer logMu.Unlock()
+	if err != nil {
+		log.Printf(format, v...)
+		return
+	}
+	log.Writer().Write(append(line, '\n'))
+}
@@ -0,0 +1,45 @@
+package awstempcreds
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogEventName(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	p := &TempCredentialsProvider{Name: "100%s-role"}
+	p.logEvent("warning", "test", nil, time.Time{}, "failed after %d attempts\n", 3)
+	if got := buf.String(); !strings.HasSuffix(got, "100%s-role: failed after 3 attempts\n") {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestJSONLoggingConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	p := &TempCredentialsProvider{JSONLogging: true}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.logEvent("warning", "test", nil, time.Time{}, "test\n")
+		}()
+	}
+	wg.Wait()
+
+	// Other tests' background refreshes may log too, so only count this one's lines.
+	if n := strings.Count(buf.String(), `"event":"test"}`+"\n"); n != 10 {
+		t.Errorf("got %d intact lines, want 10:\n%s", n, buf.String())
+	}
+}
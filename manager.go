@@ -0,0 +1,236 @@
+package awstempcreds
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Manager refreshes a set of providers in the background, ahead of their
+// expiry, so that Credentials calls on the request path rarely wait for STS.
+type Manager struct {
+	// Concurrency limits how many refreshes run at once. Defaults to 4.
+	Concurrency int
+	// Interval between checks for providers due a refresh. Defaults to 15 seconds.
+	Interval time.Duration
+	// Stagger spreads refreshes out by starting each provider's up to this
+	// much earlier than strictly needed. Defaults to 1 minute, and should
+	// stay well below the providers' ExpiryWindow.
+	Stagger time.Duration
+	// Budget, if set, is shared by all providers added to the Manager.
+	Budget *Budget
+
+	mu      sync.Mutex
+	entries map[string]*managedProvider
+}
+
+type managedProvider struct {
+	provider *TempCredentialsProvider
+	// How much earlier than its nextRefresh the provider is refreshed.
+	lead       time.Duration
+	refreshing bool
+}
+
+// Add a provider under the given name, replacing any previous one.
+// The name and the Manager's Budget are also set as the provider's Name and
+// Budget, unless it already has them. As these are exported fields, the
+// provider must be added before it is first used.
+func (m *Manager) Add(name string, p *TempCredentialsProvider) {
+	if m.Budget != nil && p.Budget == nil {
+		p.Budget = m.Budget
+	}
+	if p.Name == "" {
+		p.Name = name
+	}
+
+	stagger := m.Stagger
+	if stagger <= 0 {
+		stagger = time.Minute
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = make(map[string]*managedProvider)
+	}
+	m.entries[name] = &managedProvider{
+		provider: p,
+		lead:     time.Duration(rand.Int63n(int64(stagger))),
+	}
+}
+
+// Get the provider added under the given name, or nil.
+func (m *Manager) Get(name string) *TempCredentialsProvider {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[name]; ok {
+		return e.provider
+	}
+	return nil
+}
+
+// Remove the provider added under the given name.
+func (m *Manager) Remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, name)
+}
+
+// Run refreshes the providers as they come due until ctx is done.
+// Providers can be added and removed while it runs.
+func (m *Manager) Run(ctx context.Context) {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	concurrency := m.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for name, e := range m.due() {
+			wg.Add(1)
+			go func(name string, e *managedProvider) {
+				defer wg.Done()
+
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					m.done(e)
+					return
+				}
+				e.provider.checkExpiringSoon()
+				err := e.provider.refreshIfDue(e.lead)
+				<-slots
+
+				if err != nil {
+					e.provider.logEvent("error", "manager-refresh-failed", err, time.Time{}, "Manager failed to refresh %s: %s\n", name, err)
+				}
+				m.done(e)
+			}(name, e)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Collect the providers due a refresh, marking them as refreshing.
+func (m *Manager) due() map[string]*managedProvider {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due := make(map[string]*managedProvider)
+	now := time.Now()
+	for name, e := range m.entries {
+		if e.refreshing {
+			continue
+		}
+		if e.provider.dueWithin(now, e.lead) {
+			e.refreshing = true
+			due[name] = e
+		}
+	}
+	return due
+}
+
+func (m *Manager) done(e *managedProvider) {
+	m.mu.Lock()
+	e.refreshing = false
+	m.mu.Unlock()
+}
+
+func (p *TempCredentialsProvider) dueWithin(now time.Time, lead time.Duration) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.isDue(now, lead)
+}
+
+func (p *TempCredentialsProvider) isDue(now time.Time, lead time.Duration) bool {
+	return !now.Add(lead).Before(p.nextRefresh)
+}
+
+func (p *TempCredentialsProvider) checkExpiringSoon() {
+	p.mu.Lock()
+	p.emitExpiringSoon()
+	p.unlock()
+}
+
+// Refresh unless the credentials were refreshed on the request path
+// while the Manager was waiting for a free slot.
+func (p *TempCredentialsProvider) refreshIfDue(lead time.Duration) error {
+	return p.refreshUnless(func() bool { return !p.isDue(time.Now(), lead) })
+}
+
+// ProviderStatus is the health of a single provider held by a Manager.
+type ProviderStatus struct {
+	Labels map[string]string
+	// RoleARN is the configured role, AssumedRoleARN the current session.
+	RoleARN             string
+	AssumedRoleARN      string
+	LastRefresh         time.Time
+	LastError           error
+	ConsecutiveFailures int
+	Expiration          time.Time
+	// Overdue is how long ago the credentials were due for a refresh,
+	// or zero if they are not due yet.
+	Overdue time.Duration
+	// Expired is set if there are no usable credentials.
+	Expired bool
+	// Usage of the provider's credentials, see UsageCount, LastUsed and UnusedSessions.
+	UsageCount     int
+	LastUsed       time.Time
+	UnusedSessions int
+}
+
+// Status reports the health of every provider by name, so that callers
+// can degrade gracefully for the roles whose refreshes are failing.
+func (m *Manager) Status() map[string]ProviderStatus {
+	m.mu.Lock()
+	providers := make(map[string]*TempCredentialsProvider, len(m.entries))
+	for name, e := range m.entries {
+		providers[name] = e.provider
+	}
+	m.mu.Unlock()
+
+	status := make(map[string]ProviderStatus, len(providers))
+	for name, p := range providers {
+		status[name] = p.status()
+	}
+	return status
+}
+
+func (p *TempCredentialsProvider) status() ProviderStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.countUnused(false)
+
+	s := ProviderStatus{
+		Labels:              p.Labels,
+		RoleARN:             p.RoleARN,
+		AssumedRoleARN:      p.assumedRoleARN(),
+		LastRefresh:         p.lastRefresh,
+		LastError:           p.lastErr,
+		ConsecutiveFailures: p.consecutiveFailures,
+		Expiration:          p.expiration(),
+		Expired:             !p.lasts(0),
+		UsageCount:          p.uses,
+		LastUsed:            p.lastUsed,
+		UnusedSessions:      p.unusedSessions,
+	}
+	if overdue := time.Since(p.nextRefresh); overdue > 0 && p.creds != nil {
+		s.Overdue = overdue
+	}
+	return s
+}
@@ -0,0 +1,67 @@
+package awstempcreds
+
+import (
+	"expvar"
+	"time"
+)
+
+// Refresh counters published via expvar. All values are expvar types, so
+// /debug/vars can read them safely while the provider is in use.
+type expvarMetrics struct {
+	refreshes   *expvar.Int
+	failures    *expvar.Int
+	lastRefresh *expvar.Int
+	expiry      *expvar.Int
+}
+
+// PublishExpvar exposes refresh counters under the given expvar namespace,
+// so they show up on the standard /debug/vars endpoint.
+// Like expvar.NewMap, it panics if the namespace is already registered.
+func (p *TempCredentialsProvider) PublishExpvar(namespace string) {
+	m := &expvarMetrics{
+		refreshes:   new(expvar.Int),
+		failures:    new(expvar.Int),
+		lastRefresh: new(expvar.Int),
+		expiry:      new(expvar.Int),
+	}
+
+	name := new(expvar.String)
+	name.Set(p.Name)
+	labels := p.Labels
+
+	vars := expvar.NewMap(namespace)
+	vars.Set("name", name)
+	vars.Set("labels", expvar.Func(func() interface{} {
+		return labels
+	}))
+	vars.Set("refreshes", m.refreshes)
+	vars.Set("failures", m.failures)
+	vars.Set("last_refresh_unix", m.lastRefresh)
+	vars.Set("seconds_to_expiry", expvar.Func(func() interface{} {
+		expiry := m.expiry.Value()
+		if expiry == 0 {
+			return 0
+		}
+		return expiry - time.Now().Unix()
+	}))
+
+	p.mu.Lock()
+	p.metrics = m
+	p.mu.Unlock()
+}
+
+func (m *expvarMetrics) recordRefresh(expiry time.Time) {
+	if m == nil {
+		return
+	}
+	m.refreshes.Add(1)
+	m.lastRefresh.Set(time.Now().Unix())
+	m.expiry.Set(expiry.Unix())
+}
+
+func (m *expvarMetrics) recordFailure() {
+	if m == nil {
+		return
+	}
+	m.failures.Add(1)
+}
@@ -0,0 +1,84 @@
+package awstempcreds
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// TOTP returns a TokenProvider generating RFC 6238 codes from a base32
+// encoded secret, as shown when enrolling a virtual MFA device. This allows
+// MFA-protected roles to be assumed without user interaction.
+func TOTP(secret string) (func() (string, error), error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (string, error) {
+		return totpCode(key, time.Now()), nil
+	}, nil
+}
+
+// TOTPFromFile returns a TokenProvider reading the base32 encoded secret from
+// the given file on each refresh, so the secret is not held in memory.
+func TOTPFromFile(path string) func() (string, error) {
+	return func() (string, error) {
+		secret, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		key, err := decodeTOTPSecret(string(secret))
+		if err != nil {
+			return "", fmt.Errorf("invalid TOTP secret in %s: %s", path, err)
+		}
+		return totpCode(key, time.Now()), nil
+	}
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Join(strings.Fields(secret), ""))
+	secret = strings.TrimRight(secret, "=")
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+}
+
+// Six digit code for the 30 second step containing t.
+func totpCode(key []byte, t time.Time) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/30))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000)
+}
+
+// YubiKeyOATH returns a TokenProvider reading the code for the given OATH
+// account from a YubiKey via the ykman tool. The seed never leaves the key;
+// if the account requires touch, ykman prompts for it on stderr.
+func YubiKeyOATH(account string) func() (string, error) {
+	return func() (string, error) {
+		cmd := exec.Command("ykman", "oath", "accounts", "code", "--single", account)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("ykman failed to produce a code for %s: %s", account, err)
+		}
+
+		code := strings.TrimSpace(string(out))
+		if len(code) != 6 || strings.Trim(code, "0123456789") != "" {
+			return "", fmt.Errorf("ykman returned an unexpected code for %s: %q", account, code)
+		}
+		return code, nil
+	}
+}
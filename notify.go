@@ -0,0 +1,122 @@
+package awstempcreds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/service/sns"
+)
+
+// NotifyFailures subscribes send to the refresh failures worth telling a human
+// about: maxFailures consecutive failures, EventExpiryImminent, and the
+// credentials actually expiring. Each is reported once until the next
+// successful refresh. Messages are sent in the background, so a slow
+// notifier never holds up Credentials. The returned id can be passed to
+// Unsubscribe.
+func (p *TempCredentialsProvider) NotifyFailures(maxFailures int, send func(subject, message string) error) int {
+	var mu sync.Mutex
+	notified := make(map[EventType]bool)
+
+	return p.Subscribe(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case e.Type == EventRefreshed:
+			notified = make(map[EventType]bool)
+			return
+		case e.Type == EventRefreshFailed && e.ConsecutiveFailures < maxFailures:
+			return
+		case notified[e.Type]:
+			return
+		}
+		notified[e.Type] = true
+
+		subject, message := p.notification(e)
+		go func() {
+			err := send(subject, message)
+			if err != nil {
+				p.logEvent("error", "notify-failed", err, e.Expiration, "TempCredentialsProvider failed to send notification: %s\n", err)
+			}
+		}()
+	}, EventRefreshed, EventRefreshFailed, EventExpiryImminent, EventExpired)
+}
+
+func (p *TempCredentialsProvider) notification(e Event) (subject, message string) {
+	name := p.Name
+	if name == "" {
+		name = p.RoleARN
+	}
+
+	switch e.Type {
+	case EventExpired:
+		subject = fmt.Sprintf("Credentials for %s have expired", name)
+	case EventExpiryImminent:
+		subject = fmt.Sprintf("Credentials for %s are about to expire", name)
+	default:
+		subject = fmt.Sprintf("Credentials for %s are failing to refresh", name)
+	}
+
+	message = fmt.Sprintf("%s\n\nRole: %s\nExpiration: %s\nConsecutive failures: %d\nLast error: %v\n",
+		subject, p.RoleARN, e.Expiration.UTC().Format(time.RFC3339), e.ConsecutiveFailures, e.Err)
+	return subject, message
+}
+
+// Used for webhooks, so that a hung endpoint cannot pile up notification goroutines.
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// SlackNotifier returns a NotifyFailures sender posting to a Slack incoming webhook.
+func SlackNotifier(webhookURL string) func(subject, message string) error {
+	return func(subject, message string) error {
+		body, err := json.Marshal(map[string]string{"text": message})
+		if err != nil {
+			return err
+		}
+
+		resp, err := notifyClient.Post(webhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("slack webhook returned %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// SNSNotifier returns a NotifyFailures sender publishing to an SNS topic.
+// The config must not obtain its credentials from the provider being
+// watched, as those are the ones failing.
+func SNSNotifier(config *aws.Config, topicARN string) func(subject, message string) error {
+	client := sns.New(config)
+	return func(subject, message string) error {
+		_, err := client.Publish(&sns.PublishInput{
+			TopicARN: aws.String(topicARN),
+			Subject:  aws.String(snsSubject(subject)),
+			Message:  aws.String(message),
+		})
+		return err
+	}
+}
+
+// SNS subjects must be printable ASCII and at most 100 characters long,
+// so replace anything else (such as a non-ASCII Name) before truncating.
+func snsSubject(subject string) string {
+	b := make([]byte, 0, len(subject))
+	for _, c := range subject {
+		if c < ' ' || c > '~' {
+			c = '?'
+		}
+		b = append(b, byte(c))
+	}
+	if len(b) > 100 {
+		b = b[:100]
+	}
+	return string(b)
+}
@@ -0,0 +1,15 @@
+package awstempcreds
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSNSSubject(t *testing.T) {
+	if got := snsSubject("Credentials for zażółć\n are failing"); got != "Credentials for za????? are failing" {
+		t.Errorf("got %q", got)
+	}
+	if got := snsSubject(strings.Repeat("ł", 200)); len(got) != 100 {
+		t.Errorf("got %d characters, want 100", len(got))
+	}
+}
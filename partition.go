@@ -0,0 +1,57 @@
+package awstempcreds
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Region used for STS calls in each partition when Region is not set.
+var partitionRegions = map[string]string{
+	"aws":        "us-east-1",
+	"aws-cn":     "cn-north-1",
+	"aws-us-gov": "us-gov-west-1",
+}
+
+func regionPartition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	}
+	return "aws"
+}
+
+// Pick the region for STS calls from the partition of the role ARNs,
+// refusing to assume roles across partitions.
+func (p *TempCredentialsProvider) stsRegion() (string, error) {
+	role, err := ParseRoleARN(p.RoleARN)
+	if err != nil {
+		return "", err
+	}
+	partition := role.Partition
+
+	for _, roleARN := range p.FallbackRoleARNs {
+		fallback, err := ParseRoleARN(roleARN)
+		if err != nil {
+			return "", err
+		}
+		if fallback.Partition != partition {
+			return "", fmt.Errorf("fallback role %s is not in the %s partition of %s", roleARN, partition, p.RoleARN)
+		}
+	}
+
+	defaultRegion, known := partitionRegions[partition]
+	if p.Region == "" {
+		if !known {
+			return "", fmt.Errorf("unknown partition %s in role ARN %s, set Region explicitly", partition, p.RoleARN)
+		}
+		return defaultRegion, nil
+	}
+
+	// Regions of partitions not listed above can't be told apart, so trust them.
+	if known && regionPartition(p.Region) != partition {
+		return "", fmt.Errorf("role %s is in the %s partition, but Region %s is in %s", p.RoleARN, partition, p.Region, regionPartition(p.Region))
+	}
+	return p.Region, nil
+}
@@ -0,0 +1,101 @@
+package awstempcreds
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// Documented maximum length of an inline session policy.
+const maxPolicyLength = 2048
+
+// packPolicy validates an inline session policy and strips insignificant
+// whitespace from it, so that oversized policies are rejected locally with a
+// descriptive error instead of STS's opaque PackedPolicyTooLarge.
+func packPolicy(policy string) (string, error) {
+	var packed bytes.Buffer
+	err := json.Compact(&packed, []byte(policy))
+	if err != nil {
+		return "", fmt.Errorf("session policy is not valid JSON: %s", err)
+	}
+
+	if packed.Len() > maxPolicyLength {
+		return "", fmt.Errorf("session policy is %d characters once packed, over the %d character limit", packed.Len(), maxPolicyLength)
+	}
+
+	return packed.String(), nil
+}
+
+// PolicyData is passed to PolicyTemplate when it is rendered at refresh time.
+type PolicyData struct {
+	// Fields of the ARN of the role being assumed: RoleARN,
+	// or one of FallbackRoleARNs if it is denied.
+	Partition string
+	AccountID string
+	RoleName  string
+	// Now is the time of the refresh, e.g. for {{.Now.Format "2006/01/02"}} prefixes.
+	Now time.Time
+	// Vars as returned by PolicyVars.
+	Vars map[string]string
+}
+
+// Functions available to PolicyTemplate in addition to the built-in ones.
+var policyFuncs = template.FuncMap{
+	// Quote a value as a JSON string, so it cannot break out of the policy.
+	"json": func(v string) (string, error) {
+		quoted, err := json.Marshal(v)
+		return string(quoted), err
+	},
+}
+
+// Return the packed inline session policy for roleARN, or nil if there is none.
+func (p *TempCredentialsProvider) packedSessionPolicy(roleARN string) (*string, error) {
+	policy, err := p.sessionPolicy(roleARN)
+	if err != nil || policy == "" {
+		return nil, err
+	}
+	policy, err = packPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Return the inline session policy for roleARN, rendering PolicyTemplate if set.
+func (p *TempCredentialsProvider) sessionPolicy(roleARN string) (string, error) {
+	if p.PolicyTemplate == "" {
+		return p.Policy, nil
+	}
+	if p.Policy != "" {
+		return "", errors.New("only one of Policy and PolicyTemplate may be set")
+	}
+
+	tmpl, err := template.New("policy").Funcs(policyFuncs).Parse(p.PolicyTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid session policy template: %s", err)
+	}
+
+	role, err := ParseRoleARN(roleARN)
+	if err != nil {
+		return "", err
+	}
+	data := PolicyData{
+		Partition: role.Partition,
+		AccountID: role.AccountID,
+		RoleName:  role.Name,
+		Now:       time.Now().UTC(),
+	}
+	if p.PolicyVars != nil {
+		data.Vars = p.PolicyVars()
+	}
+
+	var policy bytes.Buffer
+	err = tmpl.Execute(&policy, &data)
+	if err != nil {
+		return "", fmt.Errorf("failed to render session policy template: %s", err)
+	}
+	return policy.String(), nil
+}
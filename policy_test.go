@@ -0,0 +1,42 @@
+package awstempcreds
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/service/sts"
+)
+
+// denyingSTS denies the roles in denied, recording the policy sent for each role.
+type denyingSTS struct {
+	fakeSTS
+	denied   map[string]bool
+	policies map[string]string
+}
+
+func (d *denyingSTS) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	d.policies[*input.RoleARN] = *input.Policy
+	if d.denied[*input.RoleARN] {
+		return nil, &aws.APIError{Code: "AccessDenied"}
+	}
+	return d.fakeSTS.AssumeRole(input)
+}
+
+func TestPolicyTemplateFallback(t *testing.T) {
+	fallback := "arn:aws:iam::123456789012:role/fallback"
+	client := &denyingSTS{denied: map[string]bool{testRoleARN: true}, policies: map[string]string{}}
+	p := newTestProvider(client)
+	p.FallbackRoleARNs = []string{fallback}
+	p.PolicyTemplate = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:*","Resource":"arn:{{.Partition}}:s3:::{{.RoleName}}/*"}]}`
+
+	if err := p.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if policy := client.policies[testRoleARN]; !strings.Contains(policy, ":::test/*") {
+		t.Errorf("got policy %s for %s", policy, testRoleARN)
+	}
+	if policy := client.policies[fallback]; !strings.Contains(policy, ":::fallback/*") {
+		t.Errorf("got policy %s for %s", policy, fallback)
+	}
+}
@@ -0,0 +1,69 @@
+package awstempcreds
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/service/iam"
+)
+
+// Name the IAM console uses for the inline policy revoking older sessions.
+const revokePolicyName = "AWSRevokeOlderSessions"
+
+// RevokeOlderSessionsPolicy returns the standard AWSRevokeOlderSessions
+// policy document, denying everything to sessions issued before the given time.
+func RevokeOlderSessionsPolicy(issuedBefore time.Time) string {
+	policy, _ := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []interface{}{map[string]interface{}{
+			"Effect":   "Deny",
+			"Action":   []string{"*"},
+			"Resource": []string{"*"},
+			"Condition": map[string]interface{}{
+				"DateLessThan": map[string]string{
+					"aws:TokenIssueTime": issuedBefore.UTC().Format(time.RFC3339),
+				},
+			},
+		}},
+	})
+	return string(policy)
+}
+
+// RevokeOlderSessions attaches the AWSRevokeOlderSessions policy to the named
+// role, invalidating all of its sessions issued before the given time.
+// The config must carry credentials allowed to call iam:PutRolePolicy.
+func RevokeOlderSessions(config *aws.Config, roleName string, issuedBefore time.Time) error {
+	_, err := iam.New(config).PutRolePolicy(&iam.PutRolePolicyInput{
+		RoleName:       aws.String(roleName),
+		PolicyName:     aws.String(revokePolicyName),
+		PolicyDocument: aws.String(RevokeOlderSessionsPolicy(issuedBefore)),
+	})
+	return err
+}
+
+// RevokeOlderSessions revokes every session of RoleARN issued until now,
+// including the provider's own, then immediately assumes the role again.
+// The config is used for the IAM call, see the RevokeOlderSessions function.
+func (p *TempCredentialsProvider) RevokeOlderSessions(config *aws.Config) error {
+	role, err := ParseRoleARN(p.RoleARN)
+	if err != nil {
+		return err
+	}
+
+	// The cutoff is compared to token issue times on the AWS side, with one
+	// second precision: round it up so no current session slips through.
+	p.mu.Lock()
+	skew := p.skew
+	p.mu.Unlock()
+	cutoff := time.Now().Add(skew).Truncate(time.Second).Add(time.Second)
+
+	err = RevokeOlderSessions(config, role.Name, cutoff)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the new session is not issued before the cutoff itself.
+	time.Sleep(time.Until(cutoff.Add(-skew)))
+	return p.Refresh()
+}
@@ -0,0 +1,130 @@
+package awstempcreds
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/service/sts"
+)
+
+// ProviderName identifies this package as the source of a Session.
+const ProviderName = "TempCredentialsProvider"
+
+// Session is an assumed role session: its credentials along with
+// the metadata describing them. It is also the serializable form
+// used by Snapshot.
+type Session struct {
+	AccessKeyID     string    `json:"access_key_id"`
+	SecretAccessKey string    `json:"secret_access_key"`
+	SessionToken    string    `json:"session_token"`
+	Expiration      time.Time `json:"expiration"`
+	AssumedRoleARN  string    `json:"assumed_role_arn,omitempty"`
+	SessionName     string    `json:"session_name,omitempty"`
+	ProviderName    string    `json:"provider_name,omitempty"`
+}
+
+// Credentials returns the session's credentials in the form used by the SDK.
+func (s *Session) Credentials() *aws.Credentials {
+	return &aws.Credentials{
+		AccessKeyID:     s.AccessKeyID,
+		SecretAccessKey: s.SecretAccessKey,
+		SessionToken:    s.SessionToken,
+	}
+}
+
+// Session returns the current session, refreshing it like Credentials does.
+func (p *TempCredentialsProvider) Session() (*Session, error) {
+	_, err := p.Credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.session(), nil
+}
+
+// Called with mu held, once a role has been assumed.
+func (p *TempCredentialsProvider) session() *Session {
+	s := &Session{
+		AccessKeyID:     *p.role.Credentials.AccessKeyID,
+		SecretAccessKey: *p.role.Credentials.SecretAccessKey,
+		SessionToken:    *p.role.Credentials.SessionToken,
+		Expiration:      p.expiration(),
+		AssumedRoleARN:  p.assumedRoleARN(),
+		ProviderName:    ProviderName,
+	}
+
+	// arn:aws:sts::<account>:assumed-role/<role>/<session name>
+	if i := strings.LastIndex(s.AssumedRoleARN, "/"); i >= 0 {
+		s.SessionName = s.AssumedRoleARN[i+1:]
+	}
+	return s
+}
+
+// Snapshot serializes the current session to JSON, so that a parent process
+// can assume the role once and hand the session over to its children.
+func (p *TempCredentialsProvider) Snapshot() ([]byte, error) {
+	return p.SnapshotWith(JSONCodec{})
+}
+
+// SnapshotWith serializes the current session using the given codec,
+// e.g. to encrypt it before it is written anywhere.
+func (p *TempCredentialsProvider) SnapshotWith(codec Codec) ([]byte, error) {
+	if p.InMemoryOnly {
+		return nil, errors.New("snapshots are disabled because InMemoryOnly is set")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.role == nil || p.role.Credentials == nil {
+		return nil, errors.New("no session to snapshot")
+	}
+
+	return codec.Encode(p.session())
+}
+
+// FromSnapshot restores a session produced by Snapshot. The session is served
+// until it is due for a refresh, after which RoleARN is assumed as usual.
+func (p *TempCredentialsProvider) FromSnapshot(data []byte) error {
+	return p.FromSnapshotWith(JSONCodec{}, data)
+}
+
+// FromSnapshotWith restores a session produced by SnapshotWith using the same codec.
+func (p *TempCredentialsProvider) FromSnapshotWith(codec Codec, data []byte) error {
+	s, err := codec.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	if s.AccessKeyID == "" || s.SecretAccessKey == "" || s.SessionToken == "" {
+		return errors.New("snapshot is missing credentials")
+	}
+	if !time.Now().Before(s.Expiration) {
+		return errors.New("snapshot has expired")
+	}
+
+	expiration := s.Expiration
+	role := &sts.AssumeRoleOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyID:     aws.String(s.AccessKeyID),
+			SecretAccessKey: aws.String(s.SecretAccessKey),
+			SessionToken:    aws.String(s.SessionToken),
+			Expiration:      &expiration,
+		},
+	}
+	if s.AssumedRoleARN != "" {
+		role.AssumedRoleUser = &sts.AssumedRoleUser{ARN: aws.String(s.AssumedRoleARN)}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setRole(role)
+	// The snapshot's expiration is already in terms of the local clock.
+	p.skew = 0
+	p.nextRefresh = s.Expiration.Add(-p.expiryWindow())
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package awstempcreds
+
+import "time"
+
+// LastRefresh returns the time of the last successful refresh,
+// or the zero time if there has been none.
+func (p *TempCredentialsProvider) LastRefresh() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastRefresh
+}
+
+// LastError returns the error from the last refresh, or nil if it succeeded.
+func (p *TempCredentialsProvider) LastError() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastErr
+}
+
+// ConsecutiveFailures returns the number of refreshes that failed since the
+// last successful one.
+func (p *TempCredentialsProvider) ConsecutiveFailures() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.consecutiveFailures
+}
+
+// RefreshCount returns the total number of successful refreshes.
+func (p *TempCredentialsProvider) RefreshCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.refreshes
+}
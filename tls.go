@@ -0,0 +1,65 @@
+package awstempcreds
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// MutualTLSConfig returns a server TLS config that only accepts clients
+// presenting a certificate signed by the CA in caFile. If allowedSANs is not
+// empty, the certificate must also carry one of them as a DNS, email, IP or
+// URI subject alternative name. Use it with ContainerCredentialsHandler when
+// serving credentials across a pod or VM boundary.
+func MutualTLSConfig(caFile string, allowedSANs []string) (*tls.Config, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	allowed := make(map[string]bool, len(allowedSANs))
+	for _, san := range allowedSANs {
+		allowed[san] = true
+	}
+
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		MinVersion: tls.VersionTLS12,
+		// Unlike VerifyPeerCertificate, VerifyConnection also runs when a session is resumed.
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(allowed) == 0 {
+				return nil
+			}
+			verifiedChains := cs.VerifiedChains
+			if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+				return errors.New("no verified client certificate")
+			}
+
+			for _, san := range certificateSANs(verifiedChains[0][0]) {
+				if allowed[san] {
+					return nil
+				}
+			}
+			return errors.New("client certificate has none of the allowed subject alternative names")
+		},
+	}, nil
+}
+
+func certificateSANs(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
@@ -0,0 +1,55 @@
+package awstempcreds
+
+import "time"
+
+// Called with mu held whenever credentials are handed out.
+func (p *TempCredentialsProvider) recordUse() {
+	p.uses++
+	p.sessionUses++
+	p.lastUsed = time.Now()
+}
+
+// Called with mu held when the current session is about to be replaced.
+func (p *TempCredentialsProvider) recordReplaced() {
+	p.countUnused(true)
+	p.sessionUses = 0
+	p.unusedCounted = false
+}
+
+// Count the current session as unused once it has been replaced, or found
+// expired, without its credentials ever being handed out. Called with mu held.
+func (p *TempCredentialsProvider) countUnused(replaced bool) {
+	if p.role == nil || p.sessionUses > 0 || p.unusedCounted {
+		return
+	}
+	if replaced || !time.Now().Before(p.expiration()) {
+		p.unusedSessions++
+		p.unusedCounted = true
+	}
+}
+
+// UsageCount returns how many times credentials have been handed out,
+// through Credentials, Session or Lease.
+func (p *TempCredentialsProvider) UsageCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.uses
+}
+
+// LastUsed returns when credentials were last handed out,
+// or the zero time if they never were.
+func (p *TempCredentialsProvider) LastUsed() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastUsed
+}
+
+// UnusedSessions returns how many sessions expired or were replaced without
+// their credentials ever being handed out. A high count relative to
+// RefreshCount suggests the role is stale, or its sessions are longer than needed.
+func (p *TempCredentialsProvider) UnusedSessions() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.countUnused(false)
+	return p.unusedSessions
+}
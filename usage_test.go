@@ -0,0 +1,48 @@
+package awstempcreds
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUnusedSessions(t *testing.T) {
+	p, err := NewEager(newTestProvider(&fakeSTS{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := p.UsageCount(); n != 0 {
+		t.Errorf("got %d uses after NewEager, want 0", n)
+	}
+
+	snapshot, err := JSONCodec{}.Encode(&Session{
+		AccessKeyID:     "ASIATEST",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(20 * time.Millisecond),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.FromSnapshot(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.UnusedSessions(); n != 1 {
+		t.Errorf("got %d unused sessions once replaced, want 1", n)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if n := p.UnusedSessions(); n != 2 {
+		t.Errorf("got %d unused sessions once expired, want 2", n)
+	}
+
+	// Replacing the expired session must not count it again.
+	if _, err := p.Credentials(); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.UnusedSessions(); n != 2 {
+		t.Errorf("got %d unused sessions after a refresh, want 2", n)
+	}
+	if n := p.UsageCount(); n != 1 {
+		t.Errorf("got %d uses, want 1", n)
+	}
+}